@@ -0,0 +1,528 @@
+package apollostats
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apInstanceName is the WebFinger/ActivityPub username every ApolloStats
+// instance publishes under, e.g. acct:apollostats@stats.example.org.
+const apInstanceName = "apollostats"
+
+// activityActor tracks the Fediverse-facing side of an Instance: the
+// signing key used for HTTP Signatures, and the set of followers that
+// have sent us a Follow activity. ActivityPubKeyPath is a config field on
+// Instance so the key can be persisted across restarts.
+type activityActor struct {
+	mu  sync.Mutex
+	key *rsa.PrivateKey
+	// followers maps a verified actor ID to its real inbox URL (the two
+	// are not the same thing in ActivityPub), so deliveries go to the
+	// inbox the actor itself advertises rather than the actor string an
+	// inbound request happened to supply.
+	followers map[string]string
+}
+
+// initActivityPub loads (or generates) the actor's RSA key and mounts the
+// WebFinger + ActivityPub routes. It is only called when
+// Instance.ActivityPubKeyPath is set, since publishing requires a
+// persisted signing key.
+func (i *Instance) initActivityPub() error {
+	key, e := loadOrCreateKey(i.ActivityPubKeyPath)
+	if e != nil {
+		return e
+	}
+	i.ap = &activityActor{key: key, followers: map[string]string{}}
+
+	i.router.GET("/.well-known/webfinger", i.webfinger)
+	i.router.GET("/activitypub/actor", i.apActor)
+	i.router.POST("/activitypub/inbox", i.apInbox)
+	i.router.GET("/activitypub/outbox", i.apOutbox)
+	i.router.GET("/activitypub/followers", i.apFollowers)
+
+	return nil
+}
+
+func loadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	if b, e := ioutil.ReadFile(path); e == nil {
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("activitypub: %s does not contain a PEM key", path)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		return nil, e
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if e := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); e != nil {
+		return nil, e
+	}
+	return key, nil
+}
+
+func (i *Instance) actorURL() string {
+	return fmt.Sprintf("%s/activitypub/actor", i.externalURL())
+}
+
+// externalURL is the instance's own base URL, used to build actor/object
+// IDs. It falls back to i.addr (host:port) when no public base is set.
+func (i *Instance) externalURL() string {
+	if i.BaseURL != "" {
+		return strings.TrimSuffix(i.BaseURL, "/")
+	}
+	return fmt.Sprintf("http://%s", i.addr)
+}
+
+func (i *Instance) webfinger(c *gin.Context) {
+	resource := c.Query("resource")
+	want := fmt.Sprintf("acct:%s@%s", apInstanceName, c.Request.Host)
+	if resource != want {
+		apiAbort(c, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subject": resource,
+		"links": []gin.H{
+			{
+				"rel":  "self",
+				"type": "application/activity+json",
+				"href": i.actorURL(),
+			},
+		},
+	})
+}
+
+func (i *Instance) apActor(c *gin.Context) {
+	pub, e := x509.MarshalPKIXPublicKey(&i.ap.key.PublicKey)
+	if e != nil {
+		apiAbort(c, http.StatusInternalServerError, "failed to marshal public key")
+		return
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+
+	c.JSON(http.StatusOK, gin.H{
+		"@context":          []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		"id":                i.actorURL(),
+		"type":              "Service",
+		"preferredUsername": apInstanceName,
+		"name":              "ApolloStats",
+		"inbox":             i.externalURL() + "/activitypub/inbox",
+		"outbox":            i.externalURL() + "/activitypub/outbox",
+		"followers":         i.externalURL() + "/activitypub/followers",
+		"publicKey": gin.H{
+			"id":           i.actorURL() + "#main-key",
+			"owner":        i.actorURL(),
+			"publicKeyPem": string(pubPEM),
+		},
+	})
+}
+
+// apInboxActivity is the minimal subset of an incoming ActivityPub
+// activity we need to act on Follow/Undo requests.
+type apInboxActivity struct {
+	Type   string `json:"type"`
+	Actor  string `json:"actor"`
+	Object string `json:"object"`
+}
+
+// apActorDoc is the subset of a remote actor document we need: where to
+// deliver to (Inbox, which is NOT the same as the actor's own ID URL)
+// and the public key to verify its signed requests with.
+type apActorDoc struct {
+	ID        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	PublicKey struct {
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// fetchActor dereferences an actor URL to get its real inbox and public
+// key, over a connection pinned to the IP that pinnedDeliveryClient
+// resolves and validates as public.
+func fetchActor(actorURL string) (*apActorDoc, error) {
+	client, e := pinnedDeliveryClient(actorURL)
+	if e != nil {
+		return nil, e
+	}
+
+	req, e := http.NewRequest(http.MethodGet, actorURL, nil)
+	if e != nil {
+		return nil, e
+	}
+	req.Header.Set("Accept", "application/activity+json")
+
+	resp, e := client.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("actor %s returned %d", actorURL, resp.StatusCode)
+	}
+
+	var doc apActorDoc
+	if e := json.NewDecoder(resp.Body).Decode(&doc); e != nil {
+		return nil, e
+	}
+	if doc.Inbox == "" || doc.PublicKey.PublicKeyPem == "" {
+		return nil, fmt.Errorf("actor %s is missing inbox or publicKey", actorURL)
+	}
+	return &doc, nil
+}
+
+// isSafeDeliveryTarget rejects anything that isn't a plain public
+// http(s) URL, so a Follow request can't be used to make this instance
+// sign and send requests at arbitrary internal/link-local addresses
+// (e.g. cloud metadata endpoints). It's a cheap pre-check only: the
+// actual outbound connection must go through pinnedDeliveryClient, since
+// a plain net.LookupIP here says nothing about what the host resolves
+// to by the time the real request dials out (DNS rebinding).
+func isSafeDeliveryTarget(target string) error {
+	u, e := url.Parse(target)
+	if e != nil {
+		return e
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+
+	_, e = resolveSafePublicIP(host)
+	return e
+}
+
+// resolveSafePublicIP resolves host and returns its first IP, rejecting
+// anything that resolves to a loopback/private/link-local/unspecified
+// address.
+func resolveSafePublicIP(host string) (net.IP, error) {
+	ips, e := net.LookupIP(host)
+	if e != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", host, e)
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+			return nil, fmt.Errorf("%s resolves to a non-public address (%s)", host, ip)
+		}
+	}
+	return ips[0], nil
+}
+
+// pinnedDeliveryClient validates target the same way isSafeDeliveryTarget
+// does, then returns an http.Client whose Transport dials the exact
+// validated IP for every connection it makes, regardless of what the
+// host subsequently resolves to. Without this, a plain resolve-then-dial
+// client re-resolves the host itself, so an attacker controlling DNS for
+// the target host can pass validation with a public IP and rebind to a
+// private/loopback address for the real connection a moment later.
+func pinnedDeliveryClient(target string) (*http.Client, error) {
+	u, e := url.Parse(target)
+	if e != nil {
+		return nil, e
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+
+	ip, e := resolveSafePublicIP(host)
+	if e != nil {
+		return nil, e
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, e := net.SplitHostPort(addr)
+				if e != nil {
+					return nil, e
+				}
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			},
+		},
+	}, nil
+}
+
+// verifyInboundSignature checks the request's HTTP Signature header
+// against the public key of the actor it claims to be from, so an
+// unauthenticated POST can't forge a Follow on someone else's behalf.
+func verifyInboundSignature(req *http.Request, pubKeyPEM string) error {
+	sigHeader := req.Header.Get("Signature")
+	if sigHeader == "" {
+		return fmt.Errorf("missing Signature header")
+	}
+
+	params := map[string]string{}
+	for _, part := range strings.Split(sigHeader, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 || params["signature"] == "" {
+		return fmt.Errorf("malformed Signature header")
+	}
+
+	sig, e := base64.StdEncoding.DecodeString(params["signature"])
+	if e != nil {
+		return fmt.Errorf("invalid signature encoding: %w", e)
+	}
+
+	block, _ := pem.Decode([]byte(pubKeyPEM))
+	if block == nil {
+		return fmt.Errorf("invalid public key PEM")
+	}
+	pub, e := x509.ParsePKIXPublicKey(block.Bytes)
+	if e != nil {
+		return fmt.Errorf("invalid public key: %w", e)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key is not RSA")
+	}
+
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		if h == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("(request-target): %s %s", strings.ToLower(req.Method), req.URL.RequestURI()))
+			continue
+		}
+		if h == "host" {
+			// net/http moves the Host header of a received request into
+			// req.Host and drops it from req.Header.
+			lines = append(lines, fmt.Sprintf("host: %s", req.Host))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", h, req.Header.Get(h)))
+	}
+	hashed := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+
+	return rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, hashed[:], sig)
+}
+
+func (i *Instance) apInbox(c *gin.Context) {
+	body, e := ioutil.ReadAll(c.Request.Body)
+	if e != nil {
+		apiAbort(c, http.StatusBadRequest, "invalid activity")
+		return
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var activity apInboxActivity
+	if e := json.Unmarshal(body, &activity); e != nil || activity.Actor == "" {
+		apiAbort(c, http.StatusBadRequest, "invalid activity")
+		return
+	}
+
+	if e := isSafeDeliveryTarget(activity.Actor); e != nil {
+		apiAbort(c, http.StatusForbidden, "actor not reachable")
+		return
+	}
+
+	actorDoc, e := fetchActor(activity.Actor)
+	if e != nil {
+		i.logMsg("activitypub: failed to fetch actor %s: %s", activity.Actor, e)
+		apiAbort(c, http.StatusBadRequest, "could not resolve actor")
+		return
+	}
+
+	if e := verifyInboundSignature(c.Request, actorDoc.PublicKey.PublicKeyPem); e != nil {
+		i.logMsg("activitypub: signature verification failed for %s: %s", activity.Actor, e)
+		apiAbort(c, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	if e := isSafeDeliveryTarget(actorDoc.Inbox); e != nil {
+		apiAbort(c, http.StatusForbidden, "inbox not reachable")
+		return
+	}
+
+	i.ap.mu.Lock()
+	switch activity.Type {
+	case "Follow":
+		i.ap.followers[actorDoc.ID] = actorDoc.Inbox
+	case "Undo":
+		delete(i.ap.followers, actorDoc.ID)
+	}
+	i.ap.mu.Unlock()
+
+	c.Status(http.StatusAccepted)
+}
+
+func (i *Instance) apOutbox(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"type":         "OrderedCollection",
+		"totalItems":   0,
+		"orderedItems": []gin.H{},
+	})
+}
+
+func (i *Instance) apFollowers(c *gin.Context) {
+	i.ap.mu.Lock()
+	followers := make([]string, 0, len(i.ap.followers))
+	for actorID := range i.ap.followers {
+		followers = append(followers, actorID)
+	}
+	i.ap.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"type":       "Collection",
+		"totalItems": len(followers),
+		"items":      followers,
+	})
+}
+
+// watchForNewRounds polls the cache for LatestRound.ID advancing and
+// publishes a Note activity for each newly-detected round. It is the
+// ActivityPub trigger point, mirroring how Cache.updater refreshes the
+// rest of the cached state.
+func (i *Instance) watchForNewRounds() {
+	var lastRound int64
+	for {
+		round := i.cache.LatestRound
+		if round.ID != 0 && round.ID != lastRound {
+			if lastRound != 0 {
+				i.publishRoundActivity(round)
+			}
+			lastRound = round.ID
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// publishRoundActivity signs and delivers a Note activity describing a
+// newly-detected round to every known follower inbox. It is the
+// ActivityPub counterpart of the cache's round-change detection.
+func (i *Instance) publishRoundActivity(round Round) {
+	if i.ap == nil {
+		return
+	}
+
+	note := gin.H{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           fmt.Sprintf("%s/activitypub/notes/round-%d", i.externalURL(), round.ID),
+		"type":         "Note",
+		"attributedTo": i.actorURL(),
+		"published":    time.Now().UTC().Format(time.RFC3339),
+		"content":      fmt.Sprintf("Round #%d (%s) has ended.", round.ID, round.GameMode),
+		"url":          fmt.Sprintf("%s/round/%d", i.externalURL(), round.ID),
+	}
+	activity := gin.H{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id":       fmt.Sprintf("%s/activitypub/activities/round-%d", i.externalURL(), round.ID),
+		"type":     "Create",
+		"actor":    i.actorURL(),
+		"object":   note,
+	}
+
+	i.ap.mu.Lock()
+	targets := make([]string, 0, len(i.ap.followers))
+	for _, inbox := range i.ap.followers {
+		targets = append(targets, inbox)
+	}
+	i.ap.mu.Unlock()
+
+	for _, inbox := range targets {
+		if e := i.deliverSigned(inbox, activity); e != nil {
+			i.logMsg("activitypub: failed to deliver to %s: %s", inbox, e)
+		}
+	}
+}
+
+// deliverSigned POSTs body to target, signed with the actor's RSA key
+// using the HTTP Signatures draft (the scheme Mastodon and friends
+// expect on inbox deliveries). target is re-validated and its
+// connection pinned here, not just at follow-time, so a follower can't
+// later start resolving to an internal address and turn this into an
+// SSRF relay.
+func (i *Instance) deliverSigned(target string, body gin.H) error {
+	client, e := pinnedDeliveryClient(target)
+	if e != nil {
+		return fmt.Errorf("refusing to deliver to %s: %w", target, e)
+	}
+
+	payload, e := json.Marshal(body)
+	if e != nil {
+		return e
+	}
+
+	req, e := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
+	if e != nil {
+		return e
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Host", req.URL.Host)
+
+	digest := sha256.Sum256(payload)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+
+	sig, e := i.signRequest(req)
+	if e != nil {
+		return e
+	}
+	req.Header.Set("Signature", sig)
+
+	resp, e := client.Do(req)
+	if e != nil {
+		return e
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("inbox %s returned %d", target, resp.StatusCode)
+	}
+	return nil
+}
+
+// signRequest builds the "Signature" header value per the HTTP
+// Signatures spec, signing over (request-target), host, date and digest.
+func (i *Instance) signRequest(req *http.Request) (string, error) {
+	signingString := fmt.Sprintf(
+		"(request-target): post %s\nhost: %s\ndate: %s\ndigest: %s",
+		req.URL.Path, req.Header.Get("Host"), req.Header.Get("Date"), req.Header.Get("Digest"),
+	)
+
+	hashed := sha256.Sum256([]byte(signingString))
+	sig, e := rsa.SignPKCS1v15(rand.Reader, i.ap.key, crypto.SHA256, hashed[:])
+	if e != nil {
+		return "", e
+	}
+
+	return fmt.Sprintf(
+		`keyId="%s#main-key",algorithm="rsa-sha256",headers="(request-target) host date digest",signature="%s"`,
+		i.actorURL(), base64.StdEncoding.EncodeToString(sig),
+	), nil
+}
@@ -0,0 +1,77 @@
+package apollostats
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSignRequest checks that signRequest produces a Signature header
+// that verifyInboundSignature (the same check apInbox runs on inbound
+// requests) accepts against the signing key's own public key.
+func TestSignRequest(t *testing.T) {
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatalf("GenerateKey: %s", e)
+	}
+	i := &Instance{BaseURL: "https://stats.example.org", ap: &activityActor{key: key}}
+
+	req := httptest.NewRequest(http.MethodPost, "https://remote.example.org/inbox", nil)
+	req.Header.Set("Host", "remote.example.org")
+	req.Header.Set("Date", "Sat, 25 Jul 2026 00:00:00 GMT")
+	req.Header.Set("Digest", "SHA-256=abc123")
+
+	sig, e := i.signRequest(req)
+	if e != nil {
+		t.Fatalf("signRequest: %s", e)
+	}
+	req.Header.Set("Signature", sig)
+
+	pub, e := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if e != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %s", e)
+	}
+	pubPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+
+	if e := verifyInboundSignature(req, pubPEM); e != nil {
+		t.Errorf("verifyInboundSignature rejected a signature produced by signRequest: %s", e)
+	}
+
+	// A tampered header not covered by the signature shouldn't matter...
+	req.Header.Set("X-Unrelated", "tampered")
+	if e := verifyInboundSignature(req, pubPEM); e != nil {
+		t.Errorf("verifyInboundSignature rejected after an unrelated header changed: %s", e)
+	}
+
+	// ...but tampering with a signed header must invalidate it.
+	req.Header.Set("Digest", "SHA-256=tampered")
+	if e := verifyInboundSignature(req, pubPEM); e == nil {
+		t.Errorf("verifyInboundSignature accepted a signature after a signed header changed")
+	}
+}
+
+func TestIsSafeDeliveryTarget(t *testing.T) {
+	cases := []struct {
+		target string
+		ok     bool
+	}{
+		{"not a url", false},
+		{"ftp://example.org/inbox", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://127.0.0.1/inbox", false},
+		{"http://localhost/inbox", false},
+		{"http://10.0.0.5/inbox", false},
+		{"https://8.8.8.8/inbox", true},
+	}
+
+	for _, tc := range cases {
+		e := isSafeDeliveryTarget(tc.target)
+		if (e == nil) != tc.ok {
+			t.Errorf("isSafeDeliveryTarget(%q) = %v, want ok=%v", tc.target, e, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package apollostats
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiError is the JSON error envelope returned by every /api/v1 endpoint
+// that fails, e.g. {"status":404,"error":"round not found"}.
+type apiError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+func apiAbort(c *gin.Context, status int, msg string) {
+	c.JSON(status, apiError{Status: status, Error: msg})
+}
+
+// parseID parses a route param that may carry an optional ".json" suffix
+// (e.g. "42" or "42.json"), used to support content negotiation on the
+// detail endpoints without a separate route per format.
+func parseID(raw string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSuffix(raw, ".json"), 10, 0)
+}
+
+// wantsJSON reports whether a request to one of the dual HTML/JSON
+// routes asked for the JSON form via content negotiation: either a
+// ".json" path suffix or an Accept header that prefers JSON over HTML.
+func wantsJSON(c *gin.Context) bool {
+	if strings.HasSuffix(c.Request.URL.Path, ".json") {
+		return true
+	}
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// negotiated picks htmlHandler or jsonHandler per request based on
+// wantsJSON, so the plain HTML routes (e.g. /rounds) also honor
+// "Accept: application/json" without needing a client to know about the
+// separate /api/v1 mirror.
+func negotiated(htmlHandler, jsonHandler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if wantsJSON(c) {
+			jsonHandler(c)
+			return
+		}
+		htmlHandler(c)
+	}
+}
+
+// pagination reads the ?limit=&offset= query params shared by all list
+// endpoints, clamping limit to a sane default/max.
+func pagination(c *gin.Context) (limit, offset int) {
+	limit, e := strconv.Atoi(c.Query("limit"))
+	if e != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset, e = strconv.Atoi(c.Query("offset"))
+	if e != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+func (i *Instance) initAPI() {
+	api := i.router.Group("/api/v1")
+	api.GET("/rounds", i.apiRounds)
+	api.GET("/rounds.json", i.apiRounds)
+	api.GET("/round/:round_id", i.apiRoundDetail)
+	api.GET("/characters", i.apiCharacters)
+	api.GET("/characters.json", i.apiCharacters)
+	api.GET("/character/:char_id", i.apiCharacterDetail)
+	api.GET("/bans", i.apiBans)
+	api.GET("/bans.json", i.apiBans)
+	api.GET("/game_modes", i.apiGameModes)
+	api.GET("/game_modes.json", i.apiGameModes)
+	api.GET("/countries", i.apiCountries)
+	api.GET("/countries.json", i.apiCountries)
+	api.GET("/account_items", i.apiAccountItems)
+	api.GET("/account_items.json", i.apiAccountItems)
+}
+
+func (i *Instance) apiRounds(c *gin.Context) {
+	limit, offset := pagination(c)
+	rounds := i.dbAllRounds()
+	total := len(rounds)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limit":  limit,
+		"offset": offset,
+		"total":  total,
+		"rounds": rounds[offset:end],
+	})
+}
+
+func (i *Instance) apiRoundDetail(c *gin.Context) {
+	id, e := parseID(c.Param("round_id"))
+	if e != nil {
+		apiAbort(c, http.StatusNotFound, "round not found")
+		return
+	}
+	round := i.dbGetRound(id)
+	if round.ID == 0 {
+		apiAbort(c, http.StatusNotFound, "round not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"round":  round,
+		"antags": i.dbGetAntags(id),
+		"ailaws": i.dbGetAILaws(id),
+		"deaths": i.dbGetDeaths(id),
+	})
+}
+
+func (i *Instance) apiCharacters(c *gin.Context) {
+	limit, offset := pagination(c)
+	name := c.Query("name")
+	species := c.Query("species")
+	chars := i.dbSearchCharacter(species, name)
+	total := len(chars)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limit":      limit,
+		"offset":     offset,
+		"total":      total,
+		"characters": chars[offset:end],
+	})
+}
+
+func (i *Instance) apiCharacterDetail(c *gin.Context) {
+	id, e := parseID(c.Param("char_id"))
+	if e != nil {
+		apiAbort(c, http.StatusNotFound, "character not found")
+		return
+	}
+	char := i.dbGetCharacter(id)
+	if char.ID == 0 {
+		apiAbort(c, http.StatusNotFound, "character not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"character": char})
+}
+
+func (i *Instance) apiBans(c *gin.Context) {
+	limit, offset := pagination(c)
+	ckey := c.Query("ckey")
+	bans := i.dbSearchBans(ckey)
+	total := len(bans)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limit":  limit,
+		"offset": offset,
+		"total":  total,
+		"bans":   bans[offset:end],
+	})
+}
+
+func (i *Instance) apiGameModes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"game_modes": i.cache.GameModes})
+}
+
+func (i *Instance) apiCountries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"countries": i.cache.Countries})
+}
+
+func (i *Instance) apiAccountItems(c *gin.Context) {
+	limit, offset := pagination(c)
+	items := i.dbAllAccountItems()
+	total := len(items)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"limit":         limit,
+		"offset":        offset,
+		"total":         total,
+		"account_items": items[offset:end],
+	})
+}
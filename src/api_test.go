@@ -0,0 +1,86 @@
+package apollostats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseID(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{"42", 42, false},
+		{"42.json", 42, false},
+		{"not-a-number", 0, true},
+	}
+
+	for _, tc := range cases {
+		got, e := parseID(tc.raw)
+		if (e != nil) != tc.wantErr {
+			t.Errorf("parseID(%q) error = %v, wantErr %v", tc.raw, e, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("parseID(%q) = %d, want %d", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func newTestContext(url, accept string) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, url, nil)
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+	return c, rec
+}
+
+func TestPagination(t *testing.T) {
+	cases := []struct {
+		url        string
+		wantLimit  int
+		wantOffset int
+	}{
+		{"/rounds", 100, 0},
+		{"/rounds?limit=10&offset=5", 10, 5},
+		{"/rounds?limit=0", 100, 0},
+		{"/rounds?limit=-1", 100, 0},
+		{"/rounds?limit=9000", 500, 0},
+		{"/rounds?offset=-1", 100, 0},
+	}
+
+	for _, tc := range cases {
+		c, _ := newTestContext(tc.url, "")
+		limit, offset := pagination(c)
+		if limit != tc.wantLimit || offset != tc.wantOffset {
+			t.Errorf("pagination(%q) = (%d, %d), want (%d, %d)", tc.url, limit, offset, tc.wantLimit, tc.wantOffset)
+		}
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	cases := []struct {
+		url    string
+		accept string
+		want   bool
+	}{
+		{"/rounds", "", false},
+		{"/rounds.json", "", true},
+		{"/rounds", "application/json", true},
+		{"/rounds", "text/html,application/json", false},
+		{"/rounds", "text/html", false},
+	}
+
+	for _, tc := range cases {
+		c, _ := newTestContext(tc.url, tc.accept)
+		if got := wantsJSON(c); got != tc.want {
+			t.Errorf("wantsJSON(%q, Accept=%q) = %v, want %v", tc.url, tc.accept, got, tc.want)
+		}
+	}
+}
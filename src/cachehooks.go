@@ -0,0 +1,21 @@
+package apollostats
+
+import "time"
+
+// watchCacheUpdates calls fn once for every refresh Cache.updater
+// completes, detected via the cache's own LastUpdated timestamp rather
+// than a poller running on its own independent schedule. The poll
+// interval below only controls how quickly we notice a change; it is
+// not a refresh cadence of our own.
+func (i *Instance) watchCacheUpdates(fn func()) {
+	var last time.Time
+	for {
+		if current := i.cache.LastUpdated; !current.Equal(last) {
+			last = current
+			if !last.IsZero() {
+				fn()
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
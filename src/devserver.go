@@ -0,0 +1,134 @@
+package apollostats
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// devReloadScript is injected into every rendered page when dev mode is
+// active; it opens an SSE connection to /dev/reload and reloads the page
+// the moment the server signals a template/static change.
+const devReloadScript = `<script>
+(function() {
+	var es = new EventSource("/dev/reload");
+	es.onmessage = function() { location.reload(); };
+})();
+</script>`
+
+// devReloader watches src/assettemplates and src/assetstatic on disk and
+// notifies connected /dev/reload clients whenever either tree changes.
+// It only runs when Instance.Dev is set, bypassing the generated asset
+// bundles so edits show up without a rebuild.
+type devReloader struct {
+	mu       sync.Mutex
+	watchers []chan struct{}
+}
+
+func newDevReloader() *devReloader {
+	return &devReloader{}
+}
+
+func (d *devReloader) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	d.mu.Lock()
+	d.watchers = append(d.watchers, ch)
+	d.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes ch from the watcher list, so a client that
+// disconnects (EventSource reconnects on every hiccup) doesn't leak a
+// channel into watchers for the rest of the dev session.
+func (d *devReloader) unsubscribe(ch chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for idx, w := range d.watchers {
+		if w == ch {
+			d.watchers = append(d.watchers[:idx], d.watchers[idx+1:]...)
+			return
+		}
+	}
+}
+
+func (d *devReloader) notify() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, ch := range d.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch polls the given directories for mtime changes every interval and
+// calls onChange, then notifies SSE subscribers, whenever anything under
+// them has changed. A simple poll loop is used instead of fsnotify so
+// dev mode has no extra build dependency.
+func (d *devReloader) watch(dirs []string, interval time.Duration, onChange func()) {
+	last := map[string]time.Time{}
+	for {
+		changed := false
+		for _, dir := range dirs {
+			filepath.Walk(dir, func(p string, info os.FileInfo, e error) error {
+				if e != nil || info.IsDir() {
+					return nil
+				}
+				if info.ModTime().After(last[p]) {
+					if !last[p].IsZero() {
+						changed = true
+					}
+					last[p] = info.ModTime()
+				}
+				return nil
+			})
+		}
+		if changed {
+			onChange()
+			d.notify()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// initDev wires up the live-reload SSE endpoint and starts watching the
+// on-disk template/static trees, reparsing templates as they change.
+// Only called when dev mode is requested via -dev.
+func (i *Instance) initDev(templateDir, staticDir string) {
+	i.dev = newDevReloader()
+
+	i.router.GET("/dev/reload", func(c *gin.Context) {
+		ch := i.dev.subscribe()
+		defer i.dev.unsubscribe(ch)
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.WriteHeader(http.StatusOK)
+
+		flusher, ok := c.Writer.(http.Flusher)
+		for {
+			select {
+			case <-ch:
+				fmt.Fprintf(c.Writer, "data: reload\n\n")
+				if ok {
+					flusher.Flush()
+				}
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	})
+
+	go i.dev.watch([]string{templateDir, staticDir}, time.Second, func() {
+		if e := i.loadTemplates(); e != nil {
+			i.logMsg("dev: failed to reparse templates: %s", e)
+		}
+	})
+	i.logMsg("Dev mode enabled, watching %s and %s for changes", templateDir, staticDir)
+}
@@ -0,0 +1,82 @@
+package apollostats
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// icsEscape escapes the characters RFC 5545 reserves in TEXT values.
+func icsEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `,`, `\,`, `;`, `\;`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// filterRoundsForICS sorts rounds newest-first, optionally restricts them
+// to a single game mode (case-insensitive), and caps the result at limit
+// entries.
+func filterRoundsForICS(rounds []Round, mode string, limit int) []Round {
+	sort.Slice(rounds, func(a, b int) bool { return rounds[a].ID > rounds[b].ID })
+
+	var filtered []Round
+	for _, r := range rounds {
+		if mode != "" && !strings.EqualFold(r.GameMode, mode) {
+			continue
+		}
+		filtered = append(filtered, r)
+		if len(filtered) >= limit {
+			break
+		}
+	}
+	return filtered
+}
+
+// roundsICS renders the rounds picked by the ?limit= and ?mode= query
+// params (see filterRoundsForICS) as an RFC 5545 iCalendar feed, one
+// VEVENT per round, so community members can subscribe from Google
+// Calendar / Thunderbird to see when rounds happened.
+func (i *Instance) roundsICS(c *gin.Context) {
+	limit := 200
+	if l, e := strconv.Atoi(c.Query("limit")); e == nil && l > 0 {
+		limit = l
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	mode := c.Query("mode")
+
+	rounds := i.dbAllRounds()
+	filtered := filterRoundsForICS(rounds, mode, limit)
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	b.WriteString("PRODID:-//ApolloStats//Rounds//EN\r\n")
+	b.WriteString("CALSCALE:GREGORIAN\r\n")
+
+	for _, r := range filtered {
+		antags := i.dbGetAntags(r.ID)
+		deaths := i.dbGetDeaths(r.ID)
+
+		b.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&b, "UID:round-%d@apollostats\r\n", r.ID)
+		fmt.Fprintf(&b, "DTSTAMP:%s\r\n", time.Now().UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&b, "DTSTART:%s\r\n", r.StartTime.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&b, "DTEND:%s\r\n", r.EndTime.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", icsEscape(r.GameMode))
+		fmt.Fprintf(&b, "DESCRIPTION:%s\r\n", icsEscape(fmt.Sprintf("%d antagonist(s), %d death(s)", len(antags), len(deaths))))
+		fmt.Fprintf(&b, "URL:%s/round/%d\r\n", i.externalURL(), r.ID)
+		b.WriteString("END:VEVENT\r\n")
+	}
+
+	b.WriteString("END:VCALENDAR\r\n")
+
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(b.String()))
+}
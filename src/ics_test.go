@@ -0,0 +1,63 @@
+package apollostats
+
+import (
+	"testing"
+)
+
+func TestIcsEscape(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain text", "plain text"},
+		{`back\slash`, `back\\slash`},
+		{"a, b; c", `a\, b\; c`},
+		{"line1\nline2", `line1\nline2`},
+	}
+
+	for _, tc := range cases {
+		if got := icsEscape(tc.in); got != tc.want {
+			t.Errorf("icsEscape(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFilterRoundsForICS(t *testing.T) {
+	rounds := []Round{
+		{ID: 1, GameMode: "Secret"},
+		{ID: 2, GameMode: "Extended"},
+		{ID: 3, GameMode: "secret"},
+	}
+
+	t.Run("sorts newest first", func(t *testing.T) {
+		got := filterRoundsForICS(append([]Round{}, rounds...), "", 10)
+		if len(got) != 3 || got[0].ID != 3 || got[2].ID != 1 {
+			t.Errorf("got %v, want sorted by ID descending", got)
+		}
+	})
+
+	t.Run("filters by mode case-insensitively", func(t *testing.T) {
+		got := filterRoundsForICS(append([]Round{}, rounds...), "SECRET", 10)
+		if len(got) != 2 {
+			t.Fatalf("got %d rounds, want 2", len(got))
+		}
+		for _, r := range got {
+			if r.GameMode != "Secret" && r.GameMode != "secret" {
+				t.Errorf("unexpected round in result: %v", r)
+			}
+		}
+	})
+
+	t.Run("caps at limit", func(t *testing.T) {
+		got := filterRoundsForICS(append([]Round{}, rounds...), "", 2)
+		if len(got) != 2 {
+			t.Errorf("got %d rounds, want 2", len(got))
+		}
+	})
+
+	t.Run("empty corpus", func(t *testing.T) {
+		got := filterRoundsForICS(nil, "", 10)
+		if len(got) != 0 {
+			t.Errorf("got %v, want empty", got)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package apollostats
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// These are every Prometheus collector ApolloStats exposes on
+// /metrics, so operators can alert on stalled caches or slow DB queries
+// without grep'ing verbose logs.
+var (
+	metricRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "apollostats_http_requests_total",
+		Help: "Total HTTP requests handled, by route and status code.",
+	}, []string{"route", "method", "status"})
+
+	metricRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "apollostats_http_request_duration_seconds",
+		Help:    "HTTP request latency, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	metricCacheLastUpdated = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apollostats_cache_last_updated_timestamp_seconds",
+		Help: "Unix timestamp of the last successful cache update.",
+	})
+
+	metricCacheUpdateDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "apollostats_cache_update_duration_seconds",
+		Help:    "How long a single cache update cycle took.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	metricLatestRoundID = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apollostats_latest_round_id",
+		Help: "ID of the most recently detected round.",
+	})
+
+	metricTotalRounds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apollostats_rounds_total",
+		Help: "Total number of rounds recorded in the database.",
+	})
+
+	metricTotalCharacters = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apollostats_characters_total",
+		Help: "Total number of characters recorded in the database.",
+	})
+
+	metricTotalBans = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "apollostats_bans_total",
+		Help: "Total number of bans recorded in the database.",
+	})
+
+	metricDBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "apollostats_db_query_duration_seconds",
+		Help:    "DB query latency, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// initMetrics mounts the /metrics endpoint.
+func (i *Instance) initMetrics() {
+	handler := promhttp.Handler()
+	i.router.GET("/metrics", func(c *gin.Context) {
+		handler.ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// metricsMiddleware records per-route request counts and latency
+// histograms alongside the existing logger() middleware.
+func (i *Instance) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metricRequestDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+		metricRequestsTotal.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// timeDBQuery records how long a DB call took under apollostats_db_query_duration_seconds.
+func timeDBQuery(method string, fn func()) {
+	start := time.Now()
+	fn()
+	metricDBQueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// The dbX wrappers below time each DB call under
+// apollostats_db_query_duration_seconds before returning its result,
+// giving operators query latency without touching the DB layer itself.
+
+func (i *Instance) dbAllRounds() []Round {
+	var rounds []Round
+	timeDBQuery("AllRounds", func() { rounds = i.DB.AllRounds() })
+	return rounds
+}
+
+func (i *Instance) dbGetRound(id int64) Round {
+	var round Round
+	timeDBQuery("GetRound", func() { round = i.DB.GetRound(id) })
+	return round
+}
+
+func (i *Instance) dbGetCharacter(id int64) Character {
+	var char Character
+	timeDBQuery("GetCharacter", func() { char = i.DB.GetCharacter(id) })
+	return char
+}
+
+func (i *Instance) dbSearchCharacter(species, name string) []Character {
+	var chars []Character
+	timeDBQuery("SearchCharacter", func() { chars = i.DB.SearchCharacter(species, name) })
+	return chars
+}
+
+func (i *Instance) dbSearchBans(ckey string) []Ban {
+	var bans []Ban
+	timeDBQuery("SearchBans", func() { bans = i.DB.SearchBans(ckey) })
+	return bans
+}
+
+func (i *Instance) dbAllAccountItems() []AccountItem {
+	var items []AccountItem
+	timeDBQuery("AllAccountItems", func() { items = i.DB.AllAccountItems() })
+	return items
+}
+
+func (i *Instance) dbGetAntags(id int64) []Antag {
+	var antags []Antag
+	timeDBQuery("GetAntags", func() { antags = i.DB.GetAntags(id) })
+	return antags
+}
+
+func (i *Instance) dbGetAILaws(id int64) []AILaw {
+	var laws []AILaw
+	timeDBQuery("GetAILaws", func() { laws = i.DB.GetAILaws(id) })
+	return laws
+}
+
+func (i *Instance) dbGetDeaths(id int64) []Death {
+	var deaths []Death
+	timeDBQuery("GetDeaths", func() { deaths = i.DB.GetDeaths(id) })
+	return deaths
+}
+
+// refreshDBGauges updates the DB-derived gauges from a fresh DB read.
+// Calls the DB directly (bypassing the dbX wrappers) since this is a
+// background scan driven by the cache's own refresh cycle, not a
+// request-driven query — it shouldn't be counted alongside real
+// per-request latency in apollostats_db_query_duration_seconds.
+func (i *Instance) refreshDBGauges() {
+	metricLatestRoundID.Set(float64(i.cache.LatestRound.ID))
+	metricTotalRounds.Set(float64(len(i.DB.AllRounds())))
+	metricTotalCharacters.Set(float64(len(i.DB.SearchCharacter("", ""))))
+	metricTotalBans.Set(float64(len(i.DB.SearchBans(""))))
+}
+
+// watchCacheMetrics refreshes the cache/DB gauges every time
+// Cache.updater completes a cycle, so
+// apollostats_cache_last_updated_timestamp_seconds and
+// apollostats_cache_update_duration_seconds describe the real cache
+// refresh rather than a poller on an unrelated schedule.
+func (i *Instance) watchCacheMetrics() {
+	i.watchCacheUpdates(func() {
+		metricCacheLastUpdated.Set(float64(i.cache.LastUpdated.Unix()))
+		metricCacheUpdateDuration.Observe(i.cache.UpdateTime.Seconds())
+		i.refreshDBGauges()
+	})
+}
@@ -0,0 +1,38 @@
+package apollostats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTimeDBQuery(t *testing.T) {
+	called := false
+	timeDBQuery("TestTimeDBQuery", func() { called = true })
+	if !called {
+		t.Error("timeDBQuery did not call fn")
+	}
+
+	if got := testutil.CollectAndCount(metricDBQueryDuration, "apollostats_db_query_duration_seconds"); got == 0 {
+		t.Error("timeDBQuery did not record an observation under apollostats_db_query_duration_seconds")
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	i := &Instance{}
+	r := gin.New()
+	r.Use(i.metricsMiddleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := testutil.ToFloat64(metricRequestsTotal.WithLabelValues("/ping", http.MethodGet, "200")); got < 1 {
+		t.Errorf("metricRequestsTotal{/ping,GET,200} = %v, want >= 1", got)
+	}
+}
@@ -0,0 +1,289 @@
+package apollostats
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// searchDoc is one indexed entity: a character, ban, death, or AI law.
+// Fields not applicable to a given Kind are left zero. Text is the blob
+// that unqualified query terms are matched against; Ckey and Species
+// back the ckey: and species: qualifiers, and law: is matched against
+// the Text of law docs.
+type searchDoc struct {
+	Kind    string // "character", "ban", "death", "law"
+	RoundID int64
+	Link    string
+	Title   string
+	Text    string
+	Ckey    string
+	Species string
+}
+
+// searchResult is a ranked, snippet-highlighted hit returned to callers.
+type searchResult struct {
+	Kind    string        `json:"kind"`
+	RoundID int64         `json:"round_id"`
+	Link    string        `json:"link"`
+	Title   string        `json:"title"`
+	Snippet template.HTML `json:"-"`
+	Text    string        `json:"snippet"`
+	Score   int           `json:"-"`
+}
+
+// searchIndex is a simple in-memory inverted index (token -> doc
+// indices) over character names/ckeys, ban reasons, death last-words,
+// and AI law text. It's rebuilt wholesale on the same cadence as
+// Cache.updater rather than updated incrementally, since the corpus is
+// small enough that a full rebuild is cheap.
+type searchIndex struct {
+	mu    sync.RWMutex
+	docs  []searchDoc
+	terms map[string][]int
+}
+
+var wordRE = regexp.MustCompile(`[a-z0-9]+`)
+
+func tokenize(s string) []string {
+	return wordRE.FindAllString(strings.ToLower(s), -1)
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{terms: map[string][]int{}}
+}
+
+func (s *searchIndex) build(docs []searchDoc) {
+	terms := map[string][]int{}
+	for idx, d := range docs {
+		seen := map[string]bool{}
+		for _, t := range tokenize(d.Text) {
+			if !seen[t] {
+				terms[t] = append(terms[t], idx)
+				seen[t] = true
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.docs = docs
+	s.terms = terms
+	s.mu.Unlock()
+}
+
+// searchQuery is a parsed "ckey:foo species:Vulpkanin harm" style query:
+// field-qualified terms, plus free-text terms (phrases kept intact).
+type searchQuery struct {
+	fields map[string]string
+	terms  []string
+}
+
+var fieldQueryRE = regexp.MustCompile(`(\w+):"([^"]+)"|(\w+):(\S+)|"([^"]+)"|(\S+)`)
+
+func parseSearchQuery(q string) searchQuery {
+	sq := searchQuery{fields: map[string]string{}}
+	for _, m := range fieldQueryRE.FindAllStringSubmatch(q, -1) {
+		switch {
+		case m[1] != "":
+			sq.fields[strings.ToLower(m[1])] = m[2]
+		case m[3] != "":
+			sq.fields[strings.ToLower(m[3])] = m[4]
+		case m[5] != "":
+			sq.terms = append(sq.terms, strings.ToLower(m[5]))
+		case m[6] != "":
+			sq.terms = append(sq.terms, strings.ToLower(m[6]))
+		}
+	}
+	return sq
+}
+
+// search runs a parsed query against the index, scoring each candidate
+// doc by how many distinct query terms it matched, and filtering by any
+// field qualifiers present (ckey:, species:, law: is just an alias for
+// the free-text terms against law docs).
+func (s *searchIndex) search(sq searchQuery) []searchResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := map[int]int{}
+	if len(sq.terms) == 0 {
+		for idx := range s.docs {
+			scores[idx] = 1
+		}
+	} else {
+		for _, t := range sq.terms {
+			toks := tokenize(t)
+			if len(toks) == 0 {
+				continue
+			}
+			if len(toks) == 1 {
+				for _, idx := range s.terms[toks[0]] {
+					scores[idx]++
+				}
+				continue
+			}
+			// Multi-word phrase: the inverted index only has single-word
+			// keys, so use the first word's postings as a candidate set
+			// and confirm the phrase appears verbatim in the doc text.
+			for _, idx := range s.terms[toks[0]] {
+				if strings.Contains(strings.ToLower(s.docs[idx].Text), t) {
+					scores[idx]++
+				}
+			}
+		}
+	}
+
+	results := make([]searchResult, 0, len(scores))
+	for idx, score := range scores {
+		d := s.docs[idx]
+		if v, ok := sq.fields["ckey"]; ok && !strings.EqualFold(d.Ckey, v) {
+			continue
+		}
+		if v, ok := sq.fields["species"]; ok && !strings.EqualFold(d.Species, v) {
+			continue
+		}
+		if v, ok := sq.fields["law"]; ok && d.Kind != "law" {
+			continue
+		} else if ok && !strings.Contains(strings.ToLower(d.Text), strings.ToLower(v)) {
+			continue
+		}
+
+		snippet := highlight(d.Text, sq.terms)
+		results = append(results, searchResult{
+			Kind: d.Kind, RoundID: d.RoundID, Link: d.Link, Title: d.Title,
+			Snippet: snippet, Text: string(snippet), Score: score,
+		})
+	}
+
+	sort.Slice(results, func(a, b int) bool { return results[a].Score > results[b].Score })
+	return results
+}
+
+// highlight wraps every occurrence of each query term in <mark>. Text
+// longer than the snippet size is first trimmed to a short snippet
+// around the first term found in it.
+func highlight(text string, terms []string) template.HTML {
+	const radius = 60
+	lower := strings.ToLower(text)
+	start, end := 0, len(text)
+	if len(text) > 2*radius {
+		pos := -1
+		for _, t := range terms {
+			if i := strings.Index(lower, t); i >= 0 {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			pos = 0
+		}
+		start = pos - radius
+		if start < 0 {
+			start = 0
+		}
+		end = start + 2*radius
+		if end > len(text) {
+			end = len(text)
+		}
+	}
+
+	snippet := template.HTMLEscapeString(text[start:end])
+	for _, t := range terms {
+		if t == "" {
+			continue
+		}
+		re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(template.HTMLEscapeString(t)))
+		snippet = re.ReplaceAllString(snippet, "<mark>$0</mark>")
+	}
+	return template.HTML(snippet)
+}
+
+// buildSearchIndex pulls the current corpus from the DB and rebuilds the
+// in-memory index. It calls the DB directly (bypassing the dbX
+// wrappers) since this bulk scan is driven by the cache's own refresh
+// cycle, not a request, and shouldn't be counted alongside per-request
+// query latency in apollostats_db_query_duration_seconds.
+func (i *Instance) buildSearchIndex() {
+	var docs []searchDoc
+
+	for _, ch := range i.DB.SearchCharacter("", "") {
+		docs = append(docs, searchDoc{
+			Kind: "character", Link: fmt.Sprintf("/character/%d", ch.ID),
+			Title: ch.NiceName(), Text: ch.Name + " " + ch.Ckey + " " + ch.Species,
+			Ckey: ch.Ckey, Species: ch.Species,
+		})
+	}
+
+	for _, b := range i.DB.SearchBans("") {
+		docs = append(docs, searchDoc{
+			Kind: "ban", Link: "/bans", Title: b.Ckey,
+			Text: b.Ckey + " " + b.Reason, Ckey: b.Ckey,
+		})
+	}
+
+	for _, r := range i.DB.AllRounds() {
+		for _, d := range i.DB.GetDeaths(r.ID) {
+			docs = append(docs, searchDoc{
+				Kind: "death", RoundID: r.ID, Link: fmt.Sprintf("/round/%d", r.ID),
+				Title: d.Name, Text: d.Name + " " + d.LastWords, Ckey: d.Ckey,
+			})
+		}
+		for _, l := range i.DB.GetAILaws(r.ID) {
+			docs = append(docs, searchDoc{
+				Kind: "law", RoundID: r.ID, Link: fmt.Sprintf("/round/%d", r.ID),
+				Title: fmt.Sprintf("Round #%d AI laws", r.ID), Text: l.Text,
+			})
+		}
+	}
+
+	i.searchIdx.build(docs)
+}
+
+// watchSearchIndex rebuilds the search index every time Cache.updater
+// completes a cycle, since the index is just a derived view of the same
+// data — rebuilding it on its own unrelated timer would mean the index
+// can lag behind (or needlessly repeat scans between) real cache
+// refreshes.
+func (i *Instance) watchSearchIndex() {
+	i.watchCacheUpdates(i.buildSearchIndex)
+}
+
+func (i *Instance) initSearch() {
+	i.searchIdx = newSearchIndex()
+	i.router.GET("/search", i.search)
+	i.router.GET("/api/v1/search", i.apiSearch)
+}
+
+func (i *Instance) search(c *gin.Context) {
+	q := c.Query("q")
+	results := i.searchIdx.search(parseSearchQuery(q))
+
+	grouped := map[string][]searchResult{}
+	for _, r := range results {
+		grouped[r.Kind] = append(grouped[r.Kind], r)
+	}
+
+	i.renderHTML(c, http.StatusOK, "search.html", gin.H{
+		"pagetitle": "Search",
+		"Query":     q,
+		"Results":   grouped,
+		"Total":     len(results),
+	})
+}
+
+func (i *Instance) apiSearch(c *gin.Context) {
+	q := c.Query("q")
+	results := i.searchIdx.search(parseSearchQuery(q))
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"total":   len(results),
+		"results": results,
+	})
+}
@@ -0,0 +1,67 @@
+package apollostats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	sq := parseSearchQuery(`ckey:foo species:Vulpkanin law:"harm" hello "good bye"`)
+
+	if sq.fields["ckey"] != "foo" {
+		t.Errorf("fields[ckey] = %q, want %q", sq.fields["ckey"], "foo")
+	}
+	if sq.fields["species"] != "Vulpkanin" {
+		t.Errorf("fields[species] = %q, want %q", sq.fields["species"], "Vulpkanin")
+	}
+	if sq.fields["law"] != "harm" {
+		t.Errorf("fields[law] = %q, want %q", sq.fields["law"], "harm")
+	}
+
+	wantTerms := []string{"hello", "good bye"}
+	if len(sq.terms) != len(wantTerms) {
+		t.Fatalf("terms = %v, want %v", sq.terms, wantTerms)
+	}
+	for idx, term := range wantTerms {
+		if sq.terms[idx] != term {
+			t.Errorf("terms[%d] = %q, want %q", idx, sq.terms[idx], term)
+		}
+	}
+}
+
+func TestParseSearchQueryEmpty(t *testing.T) {
+	sq := parseSearchQuery("")
+	if len(sq.terms) != 0 || len(sq.fields) != 0 {
+		t.Errorf("parseSearchQuery(\"\") = %+v, want empty", sq)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	out := highlight("the quick brown fox", []string{"quick"})
+	if !strings.Contains(string(out), "<mark>quick</mark>") {
+		t.Errorf("highlight() = %q, want a <mark>quick</mark> wrapper", out)
+	}
+}
+
+func TestHighlightNoTerms(t *testing.T) {
+	out := highlight("the quick brown fox", nil)
+	if strings.Contains(string(out), "<mark>") {
+		t.Errorf("highlight() with no terms = %q, want no <mark> tags", out)
+	}
+}
+
+func TestSearchPhraseQuery(t *testing.T) {
+	idx := newSearchIndex()
+	idx.build([]searchDoc{
+		{Kind: "death", Title: "match", Text: "good bye cruel world"},
+		{Kind: "death", Title: "no match", Text: "good morning cruel world"},
+	})
+
+	results := idx.search(parseSearchQuery(`"good bye"`))
+	if len(results) != 1 {
+		t.Fatalf("search(%q) = %d results, want 1", `"good bye"`, len(results))
+	}
+	if results[0].Title != "match" {
+		t.Errorf("search(%q) matched %q, want %q", `"good bye"`, results[0].Title, "match")
+	}
+}
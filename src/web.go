@@ -1,13 +1,19 @@
 package apollostats
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"io/ioutil"
 	"mime"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Apollo-Community/ApolloStats/src/assetstatic"
@@ -20,20 +26,50 @@ type Instance struct {
 	Verbose bool
 	DB      *DB
 
-	addr   string
-	router *gin.Engine
-	cache  *Cache
+	// Dev enables hot-reload dev mode: templates and static files are
+	// read straight from disk (bypassing the generated asset bundles)
+	// and re-served as they change, with a live-reload script injected
+	// into every page. Intended for local development only.
+	Dev bool
+
+	// BaseURL is the instance's own public URL (e.g.
+	// "https://stats.example.org"), used to build ActivityPub actor and
+	// object IDs. Falls back to addr when unset.
+	BaseURL string
+
+	// ActivityPubKeyPath, when set, enables the ActivityPub/WebFinger
+	// feed: an RSA key is loaded from (or generated and persisted to)
+	// this path and used to sign outgoing activities.
+	ActivityPubKeyPath string
+
+	addr    string
+	router  *gin.Engine
+	cache   *Cache
+	dev     *devReloader
+	funcmap template.FuncMap
+	// tmpl holds the active *template.Template behind an atomic.Value so
+	// dev mode's reparse-on-change (loadTemplates, running on its own
+	// goroutine) can swap it without racing in-flight renderHTML calls.
+	tmpl      atomic.Value
+	ap        *activityActor
+	searchIdx *searchIndex
 }
 
+const (
+	devTemplateDir = "src/assettemplates/templates"
+	devStaticDir   = "src/assetstatic/static"
+)
+
 func (i *Instance) Init() error {
 	i.cache = NewCache(i)
 	gin.SetMode(gin.ReleaseMode)
 	i.router = gin.New()
 	i.router.Use(gin.Recovery())
 	i.router.Use(i.logger())
+	i.router.Use(i.metricsMiddleware())
 
 	// Custom functions for the templates
-	funcmap := template.FuncMap{
+	i.funcmap = template.FuncMap{
 		"pretty_time": func(t time.Time) string {
 			return t.UTC().Format("2006-01-02 15:04 MST")
 		},
@@ -61,62 +97,198 @@ func (i *Instance) Init() error {
 		},
 	}
 
-	// Load templates
-	tmpl := template.New("AllTemplates").Funcs(funcmap)
-	tmplfiles, e := assettemplates.AssetDir("templates/")
+	if e := i.loadTemplates(); e != nil {
+		return e
+	}
+
+	// And static files
+	if e := i.loadStatic(); e != nil {
+		return e
+	}
+
+	// Setup all views
+	i.router.GET("/", i.index)
+	i.router.GET("/favicon.ico", i.favicon)
+	i.router.GET("/robots.txt", i.robots)
+	i.router.GET("/rounds.ics", i.roundsICS)
+
+	// JSON API mirror of the views above, for third-party tooling and
+	// dashboards that would otherwise have to scrape the HTML. The
+	// views themselves also honor content negotiation (Accept header or
+	// a ".json" suffix) so a plain /rounds request can be served either
+	// way without a client needing to know about /api/v1.
+	i.initAPI()
+	i.router.GET("/bans", negotiated(i.bans, i.apiBans))
+	i.router.GET("/account_items", negotiated(i.account_items, i.apiAccountItems))
+	i.router.GET("/rounds", negotiated(i.rounds, i.apiRounds))
+	i.router.GET("/round/:round_id", negotiated(i.round_detail, i.apiRoundDetail))
+	i.router.GET("/characters", negotiated(i.characters, i.apiCharacters))
+	i.router.GET("/character/:char_id", negotiated(i.character_detail, i.apiCharacterDetail))
+	i.router.GET("/game_modes", negotiated(i.game_modes, i.apiGameModes))
+	i.router.GET("/countries", negotiated(i.countries, i.apiCountries))
+	i.router.GET("/bans.json", i.apiBans)
+	i.router.GET("/account_items.json", i.apiAccountItems)
+	i.router.GET("/rounds.json", i.apiRounds)
+	i.router.GET("/characters.json", i.apiCharacters)
+	i.router.GET("/game_modes.json", i.apiGameModes)
+	i.router.GET("/countries.json", i.apiCountries)
+
+	// Prometheus metrics for request and cache/DB instrumentation.
+	i.initMetrics()
+
+	// Full-text search across rounds, characters, deaths, and AI laws.
+	i.initSearch()
+
+	if i.Dev {
+		i.initDev(devTemplateDir, devStaticDir)
+	}
+
+	if i.ActivityPubKeyPath != "" {
+		if e := i.initActivityPub(); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// loadTemplates (re)parses the HTML templates and atomically swaps them
+// into i.tmpl. In normal operation it reads the generated assettemplates
+// bundle; in Dev mode it reads straight from devTemplateDir so edits on
+// disk take effect without a rebuild, and injects the live-reload
+// script into every page.
+//
+// The swap goes through i.tmpl (an atomic.Value) rather than
+// router.SetHTMLTemplate because dev mode calls this from its own
+// watcher goroutine concurrently with in-flight renderHTML calls on
+// request-handling goroutines; gin's built-in HTML renderer isn't safe
+// for that.
+func (i *Instance) loadTemplates() error {
+	tmpl := template.New("AllTemplates").Funcs(i.funcmap)
+
+	tmplfiles, e := i.readTemplateFiles()
 	if e != nil {
 		return e
 	}
 	for p, b := range tmplfiles {
 		name := filepath.Base(p)
+		if i.Dev {
+			b = append(b, []byte(devReloadScript)...)
+		}
 		_, e = tmpl.New(name).Parse(string(b))
 		if e != nil {
 			return e
 		}
 	}
-	i.router.SetHTMLTemplate(tmpl)
+	i.tmpl.Store(tmpl)
+	return nil
+}
 
-	// And static files
+// renderHTML executes the named template against the currently active
+// template set, loaded atomically so it can't race with a concurrent
+// loadTemplates swap (see the Dev mode comment above).
+func (i *Instance) renderHTML(c *gin.Context, status int, name string, data gin.H) {
+	tmpl := i.tmpl.Load().(*template.Template)
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.WriteHeader(status)
+	if e := tmpl.ExecuteTemplate(c.Writer, name, data); e != nil {
+		i.logMsg("renderHTML: failed to execute %s: %s", name, e)
+	}
+}
+
+func (i *Instance) readTemplateFiles() (map[string][]byte, error) {
+	if !i.Dev {
+		return assettemplates.AssetDir("templates/")
+	}
+
+	files := map[string][]byte{}
+	entries, e := ioutil.ReadDir(devTemplateDir)
+	if e != nil {
+		return nil, e
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		b, e := ioutil.ReadFile(filepath.Join(devTemplateDir, entry.Name()))
+		if e != nil {
+			return nil, e
+		}
+		files[entry.Name()] = b
+	}
+	return files, nil
+}
+
+// loadStatic registers a GET route per static asset. In Dev mode it reads
+// straight from devStaticDir on every request so edits show up without a
+// restart; otherwise it serves the generated assetstatic bundle.
+func (i *Instance) loadStatic() error {
 	staticfiles, e := assetstatic.AssetDir("static/")
 	if e != nil {
 		return e
 	}
-	for p, _ := range staticfiles {
+	for p := range staticfiles {
 		ctype := mime.TypeByExtension(filepath.Ext(p))
+		path := p
 		// Need to make a local copy of the var or else all files will
 		// return the content of a single file (quirk with range).
 		b := staticfiles[p]
 		i.router.GET(fmt.Sprintf("/%s", p), func(c *gin.Context) {
+			if i.Dev {
+				if fresh, e := ioutil.ReadFile(filepath.Join(devStaticDir, strings.TrimPrefix(path, "static/"))); e == nil {
+					c.Data(http.StatusOK, ctype, fresh)
+					return
+				}
+			}
 			c.Data(http.StatusOK, ctype, b)
 		})
 	}
-
-	// Setup all views
-	i.router.GET("/", i.index)
-	i.router.GET("/favicon.ico", i.favicon)
-	i.router.GET("/robots.txt", i.robots)
-	i.router.GET("/bans", i.bans)
-	i.router.GET("/account_items", i.account_items)
-	i.router.GET("/rounds", i.rounds)
-	i.router.GET("/round/:round_id", i.round_detail)
-	i.router.GET("/characters", i.characters)
-	i.router.GET("/character/:char_id", i.character_detail)
-	i.router.GET("/game_modes", i.game_modes)
-	i.router.GET("/countries", i.countries)
-
 	return nil
 }
 
 func (i *Instance) Serve(addr string) error {
 	i.addr = addr
-	defer i.cache.close()
 	go i.cache.updater()
-	i.logMsg("Now listening on %s", addr)
-	return i.router.Run(i.addr)
+	go i.watchCacheMetrics()
+	go i.watchSearchIndex()
+	if i.ap != nil {
+		go i.watchForNewRounds()
+	}
+
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: i.router,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		i.logMsg("Now listening on %s", addr)
+		if e := srv.ListenAndServe(); e != nil && e != http.ErrServerClosed {
+			serveErr <- e
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case e := <-serveErr:
+		i.cache.close()
+		return e
+	case <-stop:
+		i.logMsg("Shutting down...")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	e := srv.Shutdown(ctx)
+	i.cache.close()
+	return e
 }
 
 func (i *Instance) index(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "index.html", gin.H{
 		"pagetitle":   "Index",
 		"Round":       i.cache.LatestRound,
 		"Stats":       i.cache.GameStats,
@@ -135,25 +307,25 @@ func (i *Instance) robots(c *gin.Context) {
 
 func (i *Instance) bans(c *gin.Context) {
 	ckey := c.Query("ckey")
-	bans := i.DB.SearchBans(ckey)
+	bans := i.dbSearchBans(ckey)
 
-	c.HTML(http.StatusOK, "bans.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "bans.html", gin.H{
 		"pagetitle": "Bans",
 		"Bans":      bans,
 	})
 }
 
 func (i *Instance) account_items(c *gin.Context) {
-	c.HTML(http.StatusOK, "account_items.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "account_items.html", gin.H{
 		"pagetitle":    "Account Items",
-		"AccountItems": i.DB.AllAccountItems(),
+		"AccountItems": i.dbAllAccountItems(),
 	})
 }
 
 func (i *Instance) rounds(c *gin.Context) {
-	c.HTML(http.StatusOK, "rounds.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "rounds.html", gin.H{
 		"pagetitle": "Rounds",
-		"Rounds":    i.DB.AllRounds(),
+		"Rounds":    i.dbAllRounds(),
 	})
 }
 
@@ -162,23 +334,23 @@ func (i *Instance) round_detail(c *gin.Context) {
 	if e != nil {
 		id = -1
 	}
-	round := i.DB.GetRound(id)
+	round := i.dbGetRound(id)
 
-	c.HTML(http.StatusOK, "round_detail.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "round_detail.html", gin.H{
 		"pagetitle": fmt.Sprintf("Round #%d", round.ID),
 		"Round":     round,
-		"Antags":    i.DB.GetAntags(id),
-		"AILaws":    i.DB.GetAILaws(id),
-		"Deaths":    i.DB.GetDeaths(id),
+		"Antags":    i.dbGetAntags(id),
+		"AILaws":    i.dbGetAILaws(id),
+		"Deaths":    i.dbGetDeaths(id),
 	})
 }
 
 func (i *Instance) characters(c *gin.Context) {
 	name := c.Query("name")
 	species := c.Query("species")
-	chars := i.DB.SearchCharacter(species, name)
+	chars := i.dbSearchCharacter(species, name)
 
-	c.HTML(http.StatusOK, "characters.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "characters.html", gin.H{
 		"pagetitle": "Characters",
 		"Chars":     chars,
 	})
@@ -189,23 +361,23 @@ func (i *Instance) character_detail(c *gin.Context) {
 	if e != nil {
 		id = -1
 	}
-	char := i.DB.GetCharacter(id)
+	char := i.dbGetCharacter(id)
 
-	c.HTML(http.StatusOK, "character_detail.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "character_detail.html", gin.H{
 		"pagetitle": char.NiceName(),
 		"Char":      char,
 	})
 }
 
 func (i *Instance) game_modes(c *gin.Context) {
-	c.HTML(http.StatusOK, "game_modes.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "game_modes.html", gin.H{
 		"pagetitle": "Game modes",
 		"GameModes": i.cache.GameModes,
 	})
 }
 
 func (i *Instance) countries(c *gin.Context) {
-	c.HTML(http.StatusOK, "countries.html", gin.H{
+	i.renderHTML(c, http.StatusOK, "countries.html", gin.H{
 		"pagetitle": "Countries",
 		"Countries": i.cache.Countries,
 	})